@@ -0,0 +1,105 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ServiceSpec configures the additional Service the reconciler creates alongside the
+// headless Service, for reaching ports from outside the cluster.
+type ServiceSpec struct {
+	// Type is the Kubernetes Service type to use for the additional Service, e.g.
+	// NodePort or LoadBalancer. Which ports it exposes is driven by Base.Ports: any
+	// port with a non-zero NodePort is included.
+	Type string `json:"type,omitempty"`
+}
+
+// MonitoringSpec configures optional Prometheus Operator integration.
+type MonitoringSpec struct {
+	// Enabled creates a ServiceMonitor selecting this DataNode's metric port. Ignored
+	// (and no ServiceMonitor is created) when the Prometheus Operator CRDs are not
+	// installed on the cluster.
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// Base holds the fields common to IoTDB node specs; DataNodeSpec embeds it.
+type Base struct {
+	// Replicas is the desired number of pods.
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// Image is the IoTDB container image to run.
+	Image string `json:"image,omitempty"`
+
+	// Envs are IoTDB configuration properties rendered as environment variables.
+	Envs map[string]string `json:"envs,omitempty"`
+
+	// Resources describes the compute resources required by the IoTDB container.
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Service configures an additional Service exposing the Ports that carry a
+	// NodePort outside the cluster.
+	Service *ServiceSpec `json:"service,omitempty"`
+
+	// VolumeClaimTemplate is the PVC template used for the StatefulSet's persistent storage.
+	VolumeClaimTemplate corev1.PersistentVolumeClaimSpec `json:"volumeClaimTemplate,omitempty"`
+
+	// Ports is the single source of truth for every port the container, headless
+	// Service and optional external Service expose. Set NodePort on an entry to also
+	// publish it through the external Service. When left empty, the reconciler falls
+	// back to IoTDB's documented default ports.
+	// +optional
+	Ports []corev1.ServicePort `json:"ports,omitempty"`
+
+	// Monitoring configures optional Prometheus Operator integration.
+	Monitoring *MonitoringSpec `json:"monitoring,omitempty"`
+}
+
+// DataNodeSpec defines the desired state of DataNode
+type DataNodeSpec struct {
+	Base `json:",inline"`
+}
+
+// DataNodeStatus defines the observed state of DataNode
+type DataNodeStatus struct {
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// DataNode is the Schema for the datanodes API
+type DataNode struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DataNodeSpec   `json:"spec,omitempty"`
+	Status DataNodeStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// DataNodeList contains a list of DataNode
+type DataNodeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DataNode `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DataNode{}, &DataNodeList{})
+}
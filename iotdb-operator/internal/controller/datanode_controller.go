@@ -18,15 +18,22 @@ package controller
 
 import (
 	"context"
-	"github.com/apache/iotdb-operator/internal/controller/strutil"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/apache/iotdb-operator/internal/controller/factory"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/util/retry"
-	"reflect"
 	. "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	"k8s.io/apimachinery/pkg/runtime"
@@ -37,18 +44,35 @@ import (
 	iotdbv1 "github.com/apache/iotdb-operator/api/v1"
 )
 
+// dataNodeFinalizer guards against the StatefulSet cascade-deleting or scaling down
+// a DataNode pod before it has relinquished its data regions in the IoTDB cluster.
+const dataNodeFinalizer = "iotdb.apache.org/datanode-finalizer"
+
+// decommissionPollInterval is how long we wait before re-checking whether a
+// remove-datanode Job has finished driving a node from Removing to gone.
+const decommissionPollInterval = 15 * time.Second
+
 // DataNodeReconciler reconciles a DataNode object
 type DataNodeReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// MonitoringCRDAvailable records whether the Prometheus Operator ServiceMonitor
+	// CRD was detected at manager start, so Reconcile can skip ServiceMonitor
+	// management on vanilla clusters instead of failing.
+	MonitoringCRDAvailable bool
 }
 
 //+kubebuilder:rbac:groups=iotdb.apache.org,resources=datanodes,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=iotdb.apache.org,resources=datanodes/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=iotdb.apache.org,resources=datanodes/finalizers,verbs=update
 // +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile function compares the state specified by the DataNode object against the actual cluster state.
 func (r *DataNodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -64,321 +88,387 @@ func (r *DataNodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, err
 	}
 
-	// Ensure the service exists
-	services, err := r.constructServiceForDataNode(&dataNode)
-	if err != nil {
+	if !dataNode.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, &dataNode)
+	}
+
+	if !ContainsFinalizer(&dataNode, dataNodeFinalizer) {
+		AddFinalizer(&dataNode, dataNodeFinalizer)
+		if err := r.Update(ctx, &dataNode); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if result, err := r.reconcileScaleDown(ctx, &dataNode); err != nil || !result.IsZero() {
+		return result, err
+	}
+
+	return r.ensureClusterObjects(ctx, &dataNode)
+}
+
+// ensureClusterObjects drives every object a DataNode owns through the factory
+// package, in dependency order, short-circuiting on the first error. Adding a new
+// managed resource (NetworkPolicy, a future ConfigNode-specific object, ...) only
+// means adding one more step here.
+func (r *DataNodeReconciler) ensureClusterObjects(ctx context.Context, dataNode *iotdbv1.DataNode) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		_, err := factory.CreateOrUpdateHeadlessService(ctx, dataNode, r.Client)
+		return err
+	}); err != nil {
+		logger.Error(err, "Failed to update headless Service for IoTDB DataNode")
 		return ctrl.Result{}, err
 	}
-	for _, service := range services {
-		existingService := &corev1.Service{}
-		err := r.Get(ctx, types.NamespacedName{Name: service.Name, Namespace: service.Namespace}, existingService)
-		if err != nil && errors.IsNotFound(err) {
-			if err := r.Create(ctx, &service); err != nil {
-				return ctrl.Result{}, err
-			}
-		} else if err != nil {
+
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		_, err := factory.CreateOrUpdateExternalService(ctx, dataNode, r.Client)
+		return err
+	}); err != nil {
+		logger.Error(err, "Failed to update external Service for IoTDB DataNode")
+		return ctrl.Result{}, err
+	}
+
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		_, err := factory.CreateOrUpdateClusterStateConfigMap(ctx, dataNode, r.Client)
+		return err
+	}); err != nil {
+		logger.Error(err, "Failed to update cluster state ConfigMap for IoTDB DataNode")
+		return ctrl.Result{}, err
+	}
+
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		_, err := factory.CreateOrUpdatePDB(ctx, dataNode, r.Client)
+		return err
+	}); err != nil {
+		logger.Error(err, "Failed to update PodDisruptionBudget for IoTDB DataNode")
+		return ctrl.Result{}, err
+	}
+
+	// Ensure StatefulSet exists and is up-to-date, canary-rolling pod template changes
+	// one ordinal at a time instead of letting the StatefulSet controller update
+	// every replica at once.
+	var rolloutResult ctrl.Result
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var err error
+		rolloutResult, err = r.reconcileRollout(ctx, dataNode)
+		return err
+	}); err != nil {
+		logger.Error(err, "Failed to roll out StateFulSet for IoTDB DataNode")
+		return ctrl.Result{}, err
+	}
+	if !rolloutResult.IsZero() {
+		return rolloutResult, nil
+	}
+
+	if r.MonitoringCRDAvailable && dataNode.Spec.Monitoring != nil && dataNode.Spec.Monitoring.Enabled {
+		if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			_, err := factory.CreateOrUpdateServiceMonitor(ctx, dataNode, r.Client)
+			return err
+		}); err != nil {
+			logger.Error(err, "Failed to update ServiceMonitor for IoTDB DataNode")
 			return ctrl.Result{}, err
-		} else {
-			// Ensure the service is up-to-date
-			if !reflect.DeepEqual(existingService.Spec, service.Spec) {
-				service.ResourceVersion = existingService.ResourceVersion
-				if err := r.Update(ctx, &service); err != nil {
-					return ctrl.Result{}, err
-				}
-			}
 		}
+	}
 
+	return ctrl.Result{}, nil
+}
+
+// reconcileDelete runs the finalizer cleanup: decommission every DataNode pod still
+// owned by the StatefulSet, highest ordinal first, before letting the object be GC'd.
+func (r *DataNodeReconciler) reconcileDelete(ctx context.Context, dataNode *iotdbv1.DataNode) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if !ContainsFinalizer(dataNode, dataNodeFinalizer) {
+		return ctrl.Result{}, nil
 	}
 
-	// Ensure StatefulSet exists and is up-to-date
-	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		current := &appsv1.StatefulSet{}
-		if err := r.Get(ctx, types.NamespacedName{Name: dataNode.Name, Namespace: dataNode.Namespace}, current); err != nil {
-			if err != nil && errors.IsNotFound(err) {
-				stateFulSet := r.constructStateFulSetForDataNode(&dataNode)
-				if err := r.Create(ctx, stateFulSet); err != nil {
-					return err
-				}
-				return nil
+	current := &appsv1.StatefulSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: factory.DataNodeName, Namespace: dataNode.Namespace}, current)
+	if err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	if err == nil && current.Spec.Replicas != nil {
+		for ordinal := *current.Spec.Replicas - 1; ordinal >= 0; ordinal-- {
+			podName := fmt.Sprintf("%s-%d", factory.DataNodeName, ordinal)
+			done, err := r.decommissionPod(ctx, dataNode, podName)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if !done {
+				logger.Info("Waiting for DataNode pod to be decommissioned before finalizing deletion", "pod", podName)
+				return ctrl.Result{RequeueAfter: decommissionPollInterval}, nil
 			}
-			return err
 		}
+	}
 
-		updatedStateFulSet := r.constructStateFulSetForDataNode(&dataNode)
-		if !reflect.DeepEqual(current.Spec, updatedStateFulSet.Spec) {
-			updatedStateFulSet.ResourceVersion = current.ResourceVersion
-			return r.Update(ctx, updatedStateFulSet)
+	RemoveFinalizer(dataNode, dataNodeFinalizer)
+	if err := r.Update(ctx, dataNode); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// reconcileScaleDown detects a replica scale-down before the StatefulSet spec is
+// overwritten, and decommissions the highest-ordinal pod one at a time so no replica
+// still owning data regions is cascade-deleted out from under IoTDB.
+func (r *DataNodeReconciler) reconcileScaleDown(ctx context.Context, dataNode *iotdbv1.DataNode) (ctrl.Result, error) {
+	current := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: factory.DataNodeName, Namespace: dataNode.Namespace}, current); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
 		}
-		return nil
-	})
+		return ctrl.Result{}, err
+	}
+	if current.Spec.Replicas == nil {
+		return ctrl.Result{}, nil
+	}
 
+	currentReplicas := *current.Spec.Replicas
+	desiredReplicas := int32(dataNode.Spec.Replicas)
+	if desiredReplicas >= currentReplicas {
+		return ctrl.Result{}, nil
+	}
+
+	podName := fmt.Sprintf("%s-%d", factory.DataNodeName, currentReplicas-1)
+	done, err := r.decommissionPod(ctx, dataNode, podName)
 	if err != nil {
-		logger.Error(err, "Failed to update StateFulSet for IoTDB DataNode")
 		return ctrl.Result{}, err
 	}
+	if !done {
+		return ctrl.Result{RequeueAfter: decommissionPollInterval}, nil
+	}
 
-	return ctrl.Result{}, nil
+	shrunk := currentReplicas - 1
+	current.Spec.Replicas = &shrunk
+	if err := r.Update(ctx, current); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{Requeue: true}, nil
 }
 
-func (r *DataNodeReconciler) constructStateFulSetForDataNode(dataNode *iotdbv1.DataNode) *appsv1.StatefulSet {
-	labels := map[string]string{"app": DataNodeName}
-	replicas := int32(dataNode.Spec.Replicas)
-	envVars := make([]corev1.EnvVar, 3)
-	envNum := 0
-	if dataNode.Spec.Envs != nil {
-		envNum = len(dataNode.Spec.Envs)
-		envVars = make([]corev1.EnvVar, len(dataNode.Spec.Envs)+3)
-		i := 0
-		for key, value := range dataNode.Spec.Envs {
-			if key == "dn_rpc_port" {
-				value = "6667"
-			} else if key == "dn_internal_port" {
-				value = "10730"
-			} else if key == "dn_mpp_data_exchange_port" {
-				value = "10740"
-			} else if key == "dn_schema_region_consensus_port" {
-				value = "10750"
-			} else if key == "dn_data_region_consensus_port" {
-				value = "10760"
-			} else if key == "dn_metric_prometheus_reporter_port" {
-				value = "9092"
-			} else if key == "rest_service_port" {
-				value = "18080"
-			}
-			envVars[i] = corev1.EnvVar{Name: key, Value: value}
-			i++
+// reconcileRollout ensures the StatefulSet matches the DataNode's desired state. When
+// the desired pod template differs from what was last applied, it gates the rollout by
+// driving the RollingUpdate partition down one ordinal at a time instead of handing the
+// whole Spec.Template to the StatefulSet controller, waiting for each newly-rolled pod
+// to report healthy on its IoTDB REST endpoint before the next one is allowed to roll.
+func (r *DataNodeReconciler) reconcileRollout(ctx context.Context, dataNode *iotdbv1.DataNode) (ctrl.Result, error) {
+	current := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: factory.DataNodeName, Namespace: dataNode.Namespace}, current); err != nil {
+		if errors.IsNotFound(err) {
+			_, err := factory.CreateOrUpdateStatefulSet(ctx, dataNode, r.Client, nil)
+			return ctrl.Result{}, err
 		}
+		return ctrl.Result{}, err
 	}
 
-	envVars[envNum] = corev1.EnvVar{
-		Name: "POD_NAME",
-		ValueFrom: &corev1.EnvVarSource{
-			FieldRef: &corev1.ObjectFieldSelector{
-				FieldPath: "metadata.name",
-			},
-		},
+	replicas := int32(0)
+	if current.Spec.Replicas != nil {
+		replicas = *current.Spec.Replicas
+	}
+
+	// CreateOrUpdateStatefulSet(..., strategy) writes the *entire* new Spec.Template in
+	// the same call that sets Partition, so the pod-template annotation already matches
+	// desired after the very first canary step — it can't be used on its own to tell
+	// "rollout finished" from "rollout one step in". Only StatefulSet's own status (every
+	// replica updated, and on the new revision) proves the rollout actually completed.
+	desired := factory.BuildStatefulSet(dataNode)
+	templateChanged := current.Spec.Template.Annotations[factory.LastAppliedPodTemplateAnnotation] != desired.Spec.Template.Annotations[factory.LastAppliedPodTemplateAnnotation]
+	rolloutComplete := current.Status.UpdatedReplicas == replicas && current.Status.CurrentRevision == current.Status.UpdateRevision
+	if !templateChanged && rolloutComplete {
+		_, err := factory.CreateOrUpdateStatefulSet(ctx, dataNode, r.Client, nil)
+		return ctrl.Result{}, err
+	}
+
+	// current.Status.UpdatedReplicas counts how many ordinals (from the top down)
+	// already run the new revision, so it doubles as our canary progress marker.
+	updatedReplicas := current.Status.UpdatedReplicas
+	if templateChanged {
+		// The live StatefulSet has not been handed the new template yet, so its status
+		// still counts pods on the previous revision: no ordinal runs the new one.
+		updatedReplicas = 0
+	}
+	if updatedReplicas > 0 {
+		rolledPod := fmt.Sprintf("%s-%d", factory.DataNodeName, replicas-updatedReplicas)
+		healthy, err := r.isDataNodePodHealthy(ctx, dataNode, rolledPod)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !healthy {
+			return ctrl.Result{RequeueAfter: decommissionPollInterval}, nil
+		}
 	}
-	val1 := ConfigNodeName + "-0." + ConfigNodeName + "-headless." + dataNode.Namespace + ".svc.cluster.local:10710"
-	val2 := "$(POD_NAME)." + DataNodeName + "-headless." + dataNode.Namespace + ".svc.cluster.local"
-	envVars[envNum+1] = corev1.EnvVar{Name: "dn_seed_config_node", Value: val1}
-	envVars[envNum+2] = corev1.EnvVar{Name: "dn_internal_address", Value: val2}
 
-	pvcTemplate := *r.constructPVCForDataNode(dataNode)
-	pvcName := pvcTemplate.Name
-	statefulset := &appsv1.StatefulSet{
+	nextPartition := replicas - updatedReplicas - 1
+	if nextPartition < 0 {
+		nextPartition = 0
+	}
+	strategy := &appsv1.StatefulSetUpdateStrategy{
+		Type:          appsv1.RollingUpdateStatefulSetStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{Partition: &nextPartition},
+	}
+	if _, err := factory.CreateOrUpdateStatefulSet(ctx, dataNode, r.Client, strategy); err != nil {
+		return ctrl.Result{}, err
+	}
+	// Always requeue, even once nextPartition reaches 0: partition 0 only unblocks
+	// ordinal 0, it doesn't mean ordinal 0 has rolled and gone healthy yet. The
+	// rolloutComplete check above is the only path that declares the rollout done,
+	// and it can't go true until a later reconcile observes UpdatedReplicas cover
+	// every ordinal and runs isDataNodePodHealthy against ordinal 0 like any other.
+	return ctrl.Result{RequeueAfter: decommissionPollInterval}, nil
+}
+
+// isDataNodePodHealthy polls a pod's IoTDB REST endpoint on 18080 so the canary
+// rollout only advances once the new revision is actually serving traffic.
+func (r *DataNodeReconciler) isDataNodePodHealthy(ctx context.Context, dataNode *iotdbv1.DataNode, podName string) (bool, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	url := fmt.Sprintf("http://%s.%s-headless.%s.svc.cluster.local:18080/ping", podName, factory.DataNodeName, dataNode.Namespace)
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// Unreachable most likely means the pod hasn't come back up yet; let the
+		// caller requeue and check again rather than treating this as fatal.
+		return false, nil
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// decommissionPod drives pod through IoTDB's remove-datanode CLI via an ephemeral Job
+// and reports whether the node has already finished leaving the cluster. The Job polls
+// `show datanodes` against a ConfigNode until the target node transitions from Removing
+// to gone, so a single Succeeded Job is proof the data regions have been relocated.
+func (r *DataNodeReconciler) decommissionPod(ctx context.Context, dataNode *iotdbv1.DataNode, podName string) (bool, error) {
+	jobName := podName + "-decommission"
+	job := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Name: jobName, Namespace: dataNode.Namespace}, job)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return false, err
+		}
+		newJob := r.constructDecommissionJob(dataNode, podName, jobName)
+		if err := r.Create(ctx, newJob); err != nil && !errors.IsAlreadyExists(err) {
+			return false, err
+		}
+		return false, nil
+	}
+
+	if job.Status.Succeeded > 0 {
+		return true, nil
+	}
+	if job.Status.Failed > 0 {
+		return false, fmt.Errorf("decommission job %s failed for datanode pod %s", jobName, podName)
+	}
+	return false, nil
+}
+
+// constructDecommissionJob builds the ephemeral Job that removes podName from the
+// IoTDB cluster via the ConfigNode CLI, then blocks until `show datanodes` confirms
+// the node is gone so the caller can safely reclaim its PVC.
+func (r *DataNodeReconciler) constructDecommissionJob(dataNode *iotdbv1.DataNode, podName, jobName string) *batchv1.Job {
+	seedConfigNode := factory.ConfigNodeName + "-0." + factory.ConfigNodeName + "-headless." + dataNode.Namespace + ".svc.cluster.local:10710"
+	podFQDN := podName + "." + factory.DataNodeName + "-headless." + dataNode.Namespace + ".svc.cluster.local"
+	// grep -w against the pod's full FQDN, not a bare substring of podName: for an
+	// 11+ replica DataNode, decommissioning datanode-1 would otherwise also match
+	// datanode-10..datanode-19 while they're still listed and the job would never
+	// observe "gone". The loop is bounded so a node that's actually stuck fails the
+	// Job (and counts against BackoffLimit) instead of hanging forever.
+	script := fmt.Sprintf(`set -e
+/iotdb/sbin/remove-datanode.sh -t %s:10730
+for i in $(seq 1 60); do
+  if ! /iotdb/sbin/show-datanodes.sh | grep -qw %s; then
+    exit 0
+  fi
+  sleep 5
+done
+echo "timed out waiting for %s to leave the cluster" >&2
+exit 1
+`, podFQDN, podFQDN, podFQDN)
+
+	backoffLimit := int32(3)
+	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      DataNodeName,
+			Name:      jobName,
 			Namespace: dataNode.Namespace,
-			Labels:    labels,
+			Labels:    map[string]string{"app": factory.DataNodeName, "role": "decommission"},
 		},
-		Spec: appsv1.StatefulSetSpec{
-			Replicas: &replicas,
-			Selector: &metav1.LabelSelector{
-				MatchLabels: labels,
-			},
-			ServiceName: DataNodeName + "-headless",
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
+					Labels: map[string]string{"app": factory.DataNodeName, "role": "decommission"},
 				},
 				Spec: corev1.PodSpec{
-					Affinity: &corev1.Affinity{
-						PodAntiAffinity: &corev1.PodAntiAffinity{
-							RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
-								{
-									LabelSelector: &metav1.LabelSelector{
-										MatchLabels: labels,
-									},
-									TopologyKey: "kubernetes.io/hostname",
-								},
-							},
-						},
-					},
+					RestartPolicy: corev1.RestartPolicyOnFailure,
 					Containers: []corev1.Container{
 						{
-							Name:            DataNodeName,
-							Image:           dataNode.Spec.Image,
-							ImagePullPolicy: corev1.PullIfNotPresent,
-							Ports: []corev1.ContainerPort{
-								{Name: "rpc-port", ContainerPort: 6667},
-								{Name: "internal-port", ContainerPort: 10730},
-								{Name: "exchange-port", ContainerPort: 10740},
-								{Name: "schema-port", ContainerPort: 10750},
-								{Name: "data-port", ContainerPort: 10760},
-								{Name: "rest-port", ContainerPort: 18080},
-								{Name: "metric-port", ContainerPort: 9092},
-							},
-							Resources: corev1.ResourceRequirements{
-								Limits: corev1.ResourceList{
-									corev1.ResourceCPU:    *dataNode.Spec.Resources.Limits.Cpu(),
-									corev1.ResourceMemory: *dataNode.Spec.Resources.Limits.Memory(),
-								},
-								Requests: corev1.ResourceList{
-									corev1.ResourceCPU:    *dataNode.Spec.Resources.Limits.Cpu(),
-									corev1.ResourceMemory: *dataNode.Spec.Resources.Limits.Memory(),
-								},
-							},
-							Env: envVars,
-							VolumeMounts: []corev1.VolumeMount{
-								{Name: pvcName, MountPath: "/iotdb/data", SubPath: "data"},
-								{Name: pvcName, MountPath: "/iotdb/logs", SubPath: "logs"},
-								{Name: pvcName, MountPath: "/iotdb/ext", SubPath: "ext"},
-								{Name: pvcName, MountPath: "/iotdb/.env", SubPath: ".env"},
-								{Name: pvcName, MountPath: "/iotdb/activation", SubPath: "activation"},
+							Name:    "remove-datanode",
+							Image:   dataNode.Spec.Image,
+							Command: []string{"/bin/sh", "-c", script},
+							Env: []corev1.EnvVar{
+								{Name: "dn_seed_config_node", Value: seedConfigNode},
 							},
 						},
 					},
 				},
 			},
-			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{pvcTemplate},
 		},
 	}
-	err := SetControllerReference(dataNode, statefulset, r.Scheme)
-	if err != nil {
+	if err := SetControllerReference(dataNode, job, r.Scheme); err != nil {
 		return nil
 	}
-	return statefulset
+	return job
 }
 
-func (r *DataNodeReconciler) constructServiceForDataNode(dataNode *iotdbv1.DataNode) ([]corev1.Service, error) {
-	headlessService := &corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      DataNodeName + "-headless",
-			Namespace: dataNode.Namespace,
-			Labels:    map[string]string{"app": DataNodeName},
-		},
-		Spec: corev1.ServiceSpec{
-			ClusterIP: "None",
-			Ports: []corev1.ServicePort{
-				{
-					Name:       "dn-internal-port",
-					Port:       10730,
-					TargetPort: intstr.FromInt32(10730),
-				},
-				{
-					Name:       "dn-mpp-data-exchange-port",
-					Port:       10740,
-					TargetPort: intstr.FromInt32(10750),
-				},
-				{
-					Name:       "dn-data-region-consensus-port",
-					Port:       10760,
-					TargetPort: intstr.FromInt32(10760),
-				},
-				{
-					Name:       "dn-schema-region-consensus-port",
-					Port:       10750,
-					TargetPort: intstr.FromInt32(10750),
-				},
-				{
-					Name:       "dn-rpc-port",
-					Port:       6667,
-					TargetPort: intstr.FromInt32(6667),
-				},
-				{
-					Name:       "rest-service-port",
-					Port:       18080,
-					TargetPort: intstr.FromInt32(18080),
-				},
-				{
-					Name:       "dn-metric-prometheus-reporter-port",
-					Port:       9092,
-					TargetPort: intstr.FromInt32(9092),
-				},
-			},
-			Selector: map[string]string{
-				"app": DataNodeName,
-			},
-		},
+// monitoringCRDAvailable detects whether the Prometheus Operator ServiceMonitor CRD is
+// registered on the cluster via a discovery-client check, so the operator can skip
+// ServiceMonitor management gracefully on vanilla clusters instead of crashing.
+func monitoringCRDAvailable(cfg *rest.Config) (bool, error) {
+	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return false, err
 	}
-	err := SetControllerReference(dataNode, headlessService, r.Scheme)
+	resources, err := dc.ServerResourcesForGroupVersion(monitoringv1.SchemeGroupVersion.String())
 	if err != nil {
-		return nil, err
-	}
-
-	services := []corev1.Service{*headlessService}
-
-	if dataNode.Spec.Service != nil && len(dataNode.Spec.Service.Ports) > 0 {
-		ports := make([]corev1.ServicePort, len(dataNode.Spec.Service.Ports))
-		i := 0
-		for key, value := range dataNode.Spec.Service.Ports {
-			port := value
-			if key == "dn_metric_prometheus_reporter_port" {
-				port = 9092
-				ports[i] = corev1.ServicePort{
-					Name:       strutil.ToKebabCase(key),
-					Port:       port,
-					NodePort:   value,
-					TargetPort: intstr.FromInt32(port),
-				}
-				i++
-			} else if key == "rest_service_port" {
-				port = 18080
-				ports[i] = corev1.ServicePort{
-					Name:       strutil.ToKebabCase(key),
-					Port:       port,
-					NodePort:   value,
-					TargetPort: intstr.FromInt32(port),
-				}
-				i++
-			} else if key == "dn_rpc_port" {
-				port = 6667
-				ports[i] = corev1.ServicePort{
-					Name:       strutil.ToKebabCase(key),
-					Port:       port,
-					NodePort:   value,
-					TargetPort: intstr.FromInt32(port),
-				}
-				i++
-			}
+		if errors.IsNotFound(err) || discovery.IsGroupDiscoveryFailedError(err) {
+			return false, nil
 		}
-		if i > 0 {
-			nodePorts := ports[0:i]
-			nodePortService := &corev1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      DataNodeName,
-					Namespace: dataNode.Namespace,
-					Labels:    map[string]string{"app": DataNodeName},
-				},
-				Spec: corev1.ServiceSpec{
-					Type:  corev1.ServiceType(dataNode.Spec.Service.Type),
-					Ports: nodePorts,
-					Selector: map[string]string{
-						"app": DataNodeName,
-					},
-				},
-			}
-			err := SetControllerReference(dataNode, nodePortService, r.Scheme)
-			if err != nil {
-				return nil, err
-			}
-			services = append(services, *nodePortService)
+		return false, err
+	}
+	for _, resource := range resources.APIResources {
+		if resource.Kind == monitoringv1.ServiceMonitorsKind {
+			return true, nil
 		}
 	}
-	return services, nil
+	return false, nil
 }
 
-func (r *DataNodeReconciler) constructPVCForDataNode(dataNode *iotdbv1.DataNode) *corev1.PersistentVolumeClaim {
-	pvc := &corev1.PersistentVolumeClaim{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      DataNodeName,
-			Namespace: dataNode.Namespace,
-			Labels:    map[string]string{"app": DataNodeName},
-		},
-		Spec: dataNode.Spec.VolumeClaimTemplate,
-	}
-	err := SetControllerReference(dataNode, pvc, r.Scheme)
+// SetupWithManager sets up the controller with the Manager.
+func (r *DataNodeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	available, err := monitoringCRDAvailable(mgr.GetConfig())
 	if err != nil {
-		return nil
+		return err
+	}
+	r.MonitoringCRDAvailable = available
+	if !available {
+		log.Log.Info("Prometheus Operator ServiceMonitor CRD not found, DataNode monitoring will be skipped")
 	}
-	return pvc
-}
 
-// SetupWithManager sets up the controller with the Manager.
-func (r *DataNodeReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	bldr := ctrl.NewControllerManagedBy(mgr).
 		For(&iotdbv1.DataNode{}).
 		Owns(&corev1.Service{}).
+		Owns(&corev1.ConfigMap{}).
 		Owns(&corev1.PersistentVolumeClaim{}).
-		Complete(r)
+		Owns(&batchv1.Job{}).
+		Owns(&policyv1.PodDisruptionBudget{})
+	if available {
+		bldr = bldr.Owns(&monitoringv1.ServiceMonitor{})
+	}
+	return bldr.Complete(r)
 }
@@ -0,0 +1,468 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package factory builds the Kubernetes objects a DataNode owns and upserts them
+// through mergeutil, so DataNodeReconciler.Reconcile can stay a short sequence of
+// CreateOrUpdate calls instead of mixing CRUD control flow with object construction.
+package factory
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/apache/iotdb-operator/internal/controller/mergeutil"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	iotdbv1 "github.com/apache/iotdb-operator/api/v1"
+)
+
+// DataNodeName is the well-known name of the DataNode StatefulSet (and the
+// labels/Services/ConfigMaps derived from it) this package builds. ConfigNodeName is the
+// name of the ConfigNode StatefulSet whose headless Service DataNodes use as their seed;
+// this package does not build that StatefulSet.
+const (
+	DataNodeName   = "datanode"
+	ConfigNodeName = "confignode"
+)
+
+// LastAppliedPodTemplateAnnotation records the container-level pod spec we last
+// applied, so a rollout is only triggered by a user-intended change and not by
+// fields the API server or an admission webhook filled in on the running object.
+const LastAppliedPodTemplateAnnotation = "iotdb.apache.org/last-applied-pod-template"
+
+// defaultDataNodePorts mirrors IoTDB's documented default ports and is used whenever
+// the user leaves Spec.Ports empty, preserving today's behavior.
+var defaultDataNodePorts = []corev1.ServicePort{
+	{Name: "dn-rpc-port", Port: 6667, TargetPort: intstr.FromInt32(6667)},
+	{Name: "dn-internal-port", Port: 10730, TargetPort: intstr.FromInt32(10730)},
+	{Name: "dn-mpp-data-exchange-port", Port: 10740, TargetPort: intstr.FromInt32(10740)},
+	{Name: "dn-schema-region-consensus-port", Port: 10750, TargetPort: intstr.FromInt32(10750)},
+	{Name: "dn-data-region-consensus-port", Port: 10760, TargetPort: intstr.FromInt32(10760)},
+	{Name: "rest-service-port", Port: 18080, TargetPort: intstr.FromInt32(18080)},
+	{Name: "dn-metric-prometheus-reporter-port", Port: 9092, TargetPort: intstr.FromInt32(9092)},
+}
+
+// containerPortNames shortens the default Service port names down to the
+// 15-character IANA_SVC_NAME limit required for a container's named ports.
+var containerPortNames = map[string]string{
+	"dn-rpc-port":                        "rpc-port",
+	"dn-internal-port":                   "internal-port",
+	"dn-mpp-data-exchange-port":          "exchange-port",
+	"dn-schema-region-consensus-port":    "schema-port",
+	"dn-data-region-consensus-port":      "data-port",
+	"rest-service-port":                  "rest-port",
+	"dn-metric-prometheus-reporter-port": "metric-port",
+}
+
+// portEnvKeys maps the IoTDB config keys controlled by Ports to the port name whose
+// value should be substituted in, so the env var always reflects the port the
+// container and Service actually listen on instead of a hard-coded default.
+var portEnvKeys = map[string]string{
+	"dn_rpc_port":                        "dn-rpc-port",
+	"dn_internal_port":                   "dn-internal-port",
+	"dn_mpp_data_exchange_port":          "dn-mpp-data-exchange-port",
+	"dn_schema_region_consensus_port":    "dn-schema-region-consensus-port",
+	"dn_data_region_consensus_port":      "dn-data-region-consensus-port",
+	"dn_metric_prometheus_reporter_port": "dn-metric-prometheus-reporter-port",
+	"rest_service_port":                  "rest-service-port",
+}
+
+// resolveDataNodePorts returns the DataNode's configured Ports, falling back to
+// IoTDB's documented defaults when the user hasn't set any.
+func resolveDataNodePorts(dataNode *iotdbv1.DataNode) []corev1.ServicePort {
+	if len(dataNode.Spec.Ports) > 0 {
+		return dataNode.Spec.Ports
+	}
+	return defaultDataNodePorts
+}
+
+func findPortByName(ports []corev1.ServicePort, name string) *corev1.ServicePort {
+	for i := range ports {
+		if ports[i].Name == name {
+			return &ports[i]
+		}
+	}
+	return nil
+}
+
+// buildHeadlessService constructs the stable-network-identity Service the
+// StatefulSet registers against, exposing every port in the DataNode's Ports list.
+func buildHeadlessService(dataNode *iotdbv1.DataNode) *corev1.Service {
+	ports := resolveDataNodePorts(dataNode)
+	headlessPorts := make([]corev1.ServicePort, len(ports))
+	for i, port := range ports {
+		headlessPorts[i] = corev1.ServicePort{Name: port.Name, Port: port.Port, TargetPort: port.TargetPort}
+	}
+
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      DataNodeName + "-headless",
+			Namespace: dataNode.Namespace,
+			Labels:    map[string]string{"app": DataNodeName},
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "None",
+			Ports:     headlessPorts,
+			Selector: map[string]string{
+				"app": DataNodeName,
+			},
+		},
+	}
+}
+
+// buildExternalService constructs the optional NodePort/LoadBalancer Service exposing
+// every port in the DataNode's Ports list that carries a non-zero NodePort. Returns
+// nil when the user hasn't configured Service or hasn't set a NodePort on any port.
+func buildExternalService(dataNode *iotdbv1.DataNode) *corev1.Service {
+	if dataNode.Spec.Service == nil {
+		return nil
+	}
+
+	var externalPorts []corev1.ServicePort
+	for _, port := range resolveDataNodePorts(dataNode) {
+		if port.NodePort != 0 {
+			externalPorts = append(externalPorts, port)
+		}
+	}
+	if len(externalPorts) == 0 {
+		return nil
+	}
+
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      DataNodeName,
+			Namespace: dataNode.Namespace,
+			Labels:    map[string]string{"app": DataNodeName},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceType(dataNode.Spec.Service.Type),
+			Ports: externalPorts,
+			Selector: map[string]string{
+				"app": DataNodeName,
+			},
+		},
+	}
+}
+
+// buildPVCTemplate constructs the PersistentVolumeClaim template the StatefulSet
+// embeds in its VolumeClaimTemplates. DataNode storage is managed per-replica by the
+// StatefulSet controller rather than as a standalone owned object, so there is no
+// corresponding CreateOrUpdate against the API server.
+func buildPVCTemplate(dataNode *iotdbv1.DataNode) corev1.PersistentVolumeClaim {
+	return corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      DataNodeName,
+			Namespace: dataNode.Namespace,
+			Labels:    map[string]string{"app": DataNodeName},
+		},
+		Spec: dataNode.Spec.VolumeClaimTemplate,
+	}
+}
+
+// BuildStatefulSet constructs the desired StatefulSet for dataNode. It is exported so
+// callers that need to gate a rollout (comparing LastAppliedPodTemplateAnnotation
+// against the live object before deciding how to roll it out) can inspect the desired
+// object before calling CreateOrUpdateStatefulSet.
+func BuildStatefulSet(dataNode *iotdbv1.DataNode) *appsv1.StatefulSet {
+	labels := map[string]string{"app": DataNodeName}
+	replicas := dataNode.Spec.Replicas
+	ports := resolveDataNodePorts(dataNode)
+	// listenPort is the port the container binds for a Ports entry: its TargetPort, or
+	// Port when TargetPort is left unset.
+	listenPort := func(port corev1.ServicePort) int {
+		if target := port.TargetPort.IntValue(); target != 0 {
+			return target
+		}
+		return int(port.Port)
+	}
+
+	envVars := make([]corev1.EnvVar, 3)
+	envNum := 0
+	if dataNode.Spec.Envs != nil {
+		envNum = len(dataNode.Spec.Envs)
+		envVars = make([]corev1.EnvVar, len(dataNode.Spec.Envs)+3)
+		i := 0
+		for key, value := range dataNode.Spec.Envs {
+			if portName, ok := portEnvKeys[key]; ok {
+				if port := findPortByName(ports, portName); port != nil {
+					value = strconv.Itoa(listenPort(*port))
+				}
+			}
+			envVars[i] = corev1.EnvVar{Name: key, Value: value}
+			i++
+		}
+	}
+
+	envVars[envNum] = corev1.EnvVar{
+		Name: "POD_NAME",
+		ValueFrom: &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{
+				FieldPath: "metadata.name",
+			},
+		},
+	}
+	val1 := ConfigNodeName + "-0." + ConfigNodeName + "-headless." + dataNode.Namespace + ".svc.cluster.local:10710"
+	val2 := "$(POD_NAME)." + DataNodeName + "-headless." + dataNode.Namespace + ".svc.cluster.local"
+	envVars[envNum+1] = corev1.EnvVar{Name: "dn_seed_config_node", Value: val1}
+	envVars[envNum+2] = corev1.EnvVar{Name: "dn_internal_address", Value: val2}
+
+	containerPorts := make([]corev1.ContainerPort, len(ports))
+	for i, port := range ports {
+		name := port.Name
+		if short, ok := containerPortNames[port.Name]; ok {
+			name = short
+		}
+		containerPorts[i] = corev1.ContainerPort{Name: name, ContainerPort: int32(listenPort(port))}
+	}
+
+	pvcTemplate := buildPVCTemplate(dataNode)
+	pvcName := pvcTemplate.Name
+
+	statefulset := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      DataNodeName,
+			Namespace: dataNode.Namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			ServiceName: DataNodeName + "-headless",
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					Affinity: &corev1.Affinity{
+						PodAntiAffinity: &corev1.PodAntiAffinity{
+							RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+								{
+									LabelSelector: &metav1.LabelSelector{
+										MatchLabels: labels,
+									},
+									TopologyKey: "kubernetes.io/hostname",
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:            DataNodeName,
+							Image:           dataNode.Spec.Image,
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Ports:           containerPorts,
+							Resources: corev1.ResourceRequirements{
+								Limits: corev1.ResourceList{
+									corev1.ResourceCPU:    *dataNode.Spec.Resources.Limits.Cpu(),
+									corev1.ResourceMemory: *dataNode.Spec.Resources.Limits.Memory(),
+								},
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    *dataNode.Spec.Resources.Limits.Cpu(),
+									corev1.ResourceMemory: *dataNode.Spec.Resources.Limits.Memory(),
+								},
+							},
+							Env: envVars,
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: pvcName, MountPath: "/iotdb/data", SubPath: "data"},
+								{Name: pvcName, MountPath: "/iotdb/logs", SubPath: "logs"},
+								{Name: pvcName, MountPath: "/iotdb/ext", SubPath: "ext"},
+								{Name: pvcName, MountPath: "/iotdb/.env", SubPath: ".env"},
+								{Name: pvcName, MountPath: "/iotdb/activation", SubPath: "activation"},
+							},
+						},
+					},
+				},
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{pvcTemplate},
+			// Release a pod's PVC once it's no longer part of the StatefulSet, whether
+			// that's a decommission-driven scale-down or the whole DataNode being
+			// deleted, instead of leaking storage for every DataNode this operator
+			// has ever removed.
+			PersistentVolumeClaimRetentionPolicy: &appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy{
+				WhenScaled:  appsv1.DeletePersistentVolumeClaimRetentionPolicyType,
+				WhenDeleted: appsv1.DeletePersistentVolumeClaimRetentionPolicyType,
+			},
+		},
+	}
+
+	if podTemplateJSON, err := json.Marshal(statefulset.Spec.Template.Spec); err == nil {
+		statefulset.Spec.Template.Annotations = map[string]string{
+			LastAppliedPodTemplateAnnotation: string(podTemplateJSON),
+		}
+	}
+
+	return statefulset
+}
+
+// buildClusterStateConfigMap records cluster-formation facts (the ConfigNode seed
+// address, the target replica count) that ConfigNode and DataNode reconcilers will
+// both need once ConfigNode support lands, following the same factory pattern.
+func buildClusterStateConfigMap(dataNode *iotdbv1.DataNode) *corev1.ConfigMap {
+	seedConfigNode := ConfigNodeName + "-0." + ConfigNodeName + "-headless." + dataNode.Namespace + ".svc.cluster.local:10710"
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      DataNodeName + "-cluster-state",
+			Namespace: dataNode.Namespace,
+			Labels:    map[string]string{"app": DataNodeName},
+		},
+		Data: map[string]string{
+			"dn_seed_config_node": seedConfigNode,
+			"replicas":            strconv.Itoa(int(dataNode.Spec.Replicas)),
+		},
+	}
+}
+
+// CreateOrUpdateHeadlessService upserts the DataNode's headless Service.
+func CreateOrUpdateHeadlessService(ctx context.Context, dataNode *iotdbv1.DataNode, c client.Client) (controllerutil.OperationResult, error) {
+	svc := buildHeadlessService(dataNode)
+	if err := controllerutil.SetControllerReference(dataNode, svc, c.Scheme()); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	return mergeutil.CreateOrUpdate(ctx, c, svc)
+}
+
+// CreateOrUpdateExternalService upserts the DataNode's optional NodePort/LoadBalancer
+// Service, or does nothing if the DataNode has no ports configured for external access.
+func CreateOrUpdateExternalService(ctx context.Context, dataNode *iotdbv1.DataNode, c client.Client) (controllerutil.OperationResult, error) {
+	svc := buildExternalService(dataNode)
+	if svc == nil {
+		return controllerutil.OperationResultNone, nil
+	}
+	if err := controllerutil.SetControllerReference(dataNode, svc, c.Scheme()); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	return mergeutil.CreateOrUpdate(ctx, c, svc)
+}
+
+// CreateOrUpdateStatefulSet upserts the DataNode's StatefulSet. When updateStrategy is
+// non-nil it overrides the built-in default, letting a caller gate a pod template
+// rollout behind a RollingUpdate.Partition canary.
+func CreateOrUpdateStatefulSet(ctx context.Context, dataNode *iotdbv1.DataNode, c client.Client, updateStrategy *appsv1.StatefulSetUpdateStrategy) (controllerutil.OperationResult, error) {
+	sts := BuildStatefulSet(dataNode)
+	if updateStrategy != nil {
+		sts.Spec.UpdateStrategy = *updateStrategy
+	}
+	if err := controllerutil.SetControllerReference(dataNode, sts, c.Scheme()); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	return mergeutil.CreateOrUpdate(ctx, c, sts)
+}
+
+// BuildPVCTemplate returns the PVC template CreateOrUpdateStatefulSet embeds in the
+// StatefulSet's VolumeClaimTemplates. It is exported for callers (tests, a future
+// ConfigNode factory) that need the template without building the whole StatefulSet.
+// Unlike its CreateOrUpdate* siblings it never calls the API directly: DataNode
+// storage is managed per-replica by the StatefulSet controller, not as a standalone
+// owned object.
+func BuildPVCTemplate(dataNode *iotdbv1.DataNode) corev1.PersistentVolumeClaim {
+	return buildPVCTemplate(dataNode)
+}
+
+// CreateOrUpdateClusterStateConfigMap upserts the ConfigMap recording cluster
+// formation facts.
+func CreateOrUpdateClusterStateConfigMap(ctx context.Context, dataNode *iotdbv1.DataNode, c client.Client) (controllerutil.OperationResult, error) {
+	cm := buildClusterStateConfigMap(dataNode)
+	if err := controllerutil.SetControllerReference(dataNode, cm, c.Scheme()); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	return mergeutil.CreateOrUpdate(ctx, c, cm)
+}
+
+// buildPDB computes a PodDisruptionBudget from the DataNode's replica count and
+// configured data-region replication factor, so voluntary disruptions (node drains,
+// upgrades) can't take more replicas offline than the replication factor can tolerate.
+// Defaults to maxUnavailable: 1 when no replication factor is configured, and is always
+// kept below the replica count (so a single-replica DataNode gets maxUnavailable: 0).
+func buildPDB(dataNode *iotdbv1.DataNode) *policyv1.PodDisruptionBudget {
+	maxUnavailable := int32(1)
+	if factor, ok := dataNode.Spec.Envs["data_replication_factor"]; ok {
+		if parsed, err := strconv.Atoi(factor); err == nil && parsed > 1 {
+			maxUnavailable = int32(parsed) - 1
+		}
+	}
+	// A replication factor configured at or above the replica count would otherwise
+	// produce maxUnavailable >= replicas, a PDB that permits every replica to be
+	// evicted at once — no protection at all. Clamp it so at least one replica always
+	// stays up.
+	if replicas := dataNode.Spec.Replicas; replicas > 0 && maxUnavailable >= replicas {
+		maxUnavailable = replicas - 1
+	}
+	maxUnavailableIntStr := intstr.FromInt32(maxUnavailable)
+
+	return &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      DataNodeName,
+			Namespace: dataNode.Namespace,
+			Labels:    map[string]string{"app": DataNodeName},
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MaxUnavailable: &maxUnavailableIntStr,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": DataNodeName},
+			},
+		},
+	}
+}
+
+// CreateOrUpdatePDB upserts the DataNode's PodDisruptionBudget.
+func CreateOrUpdatePDB(ctx context.Context, dataNode *iotdbv1.DataNode, c client.Client) (controllerutil.OperationResult, error) {
+	pdb := buildPDB(dataNode)
+	if err := controllerutil.SetControllerReference(dataNode, pdb, c.Scheme()); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	return mergeutil.CreateOrUpdate(ctx, c, pdb)
+}
+
+// buildServiceMonitor constructs a ServiceMonitor scraping the headless Service's
+// metric port, so Prometheus Operator installations pick up DataNode metrics without
+// the user having to write one by hand.
+func buildServiceMonitor(dataNode *iotdbv1.DataNode) *monitoringv1.ServiceMonitor {
+	return &monitoringv1.ServiceMonitor{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      DataNodeName,
+			Namespace: dataNode.Namespace,
+			Labels:    map[string]string{"app": DataNodeName},
+		},
+		Spec: monitoringv1.ServiceMonitorSpec{
+			Selector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": DataNodeName},
+			},
+			Endpoints: []monitoringv1.Endpoint{
+				{Port: "dn-metric-prometheus-reporter-port"},
+			},
+		},
+	}
+}
+
+// CreateOrUpdateServiceMonitor upserts the DataNode's ServiceMonitor. Callers must
+// only invoke this when the ServiceMonitor CRD is known to be installed.
+func CreateOrUpdateServiceMonitor(ctx context.Context, dataNode *iotdbv1.DataNode, c client.Client) (controllerutil.OperationResult, error) {
+	serviceMonitor := buildServiceMonitor(dataNode)
+	if err := controllerutil.SetControllerReference(dataNode, serviceMonitor, c.Scheme()); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	return mergeutil.CreateOrUpdate(ctx, c, serviceMonitor)
+}
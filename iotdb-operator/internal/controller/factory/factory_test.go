@@ -0,0 +1,98 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	iotdbv1 "github.com/apache/iotdb-operator/api/v1"
+)
+
+func TestResolveDataNodePorts_FallsBackToDefaults(t *testing.T) {
+	dataNode := &iotdbv1.DataNode{}
+	got := resolveDataNodePorts(dataNode)
+	if len(got) != len(defaultDataNodePorts) {
+		t.Fatalf("got %d ports, want %d defaults", len(got), len(defaultDataNodePorts))
+	}
+}
+
+func TestResolveDataNodePorts_UsesSpecWhenSet(t *testing.T) {
+	custom := []corev1.ServicePort{{Name: "dn-rpc-port", Port: 7777, TargetPort: intstr.FromInt32(7777)}}
+	dataNode := &iotdbv1.DataNode{Spec: iotdbv1.DataNodeSpec{Base: iotdbv1.Base{Ports: custom}}}
+
+	got := resolveDataNodePorts(dataNode)
+	if len(got) != 1 || got[0].Port != 7777 {
+		t.Fatalf("got %+v, want the single configured port on 7777", got)
+	}
+}
+
+// TestBuildStatefulSet_PortEnvSubstitution asserts that an env var referencing a
+// well-known port key (dn_rpc_port) is rewritten to the actual port the container and
+// Service listen on, rather than whatever literal value the user typed, so a user who
+// repoints dn-rpc-port via Ports doesn't end up with a container that disagrees with
+// its own Service about which port it's serving on.
+func TestBuildStatefulSet_PortEnvSubstitution(t *testing.T) {
+	dataNode := &iotdbv1.DataNode{
+		Spec: iotdbv1.DataNodeSpec{
+			Base: iotdbv1.Base{
+				Replicas: 1,
+				Ports:    []corev1.ServicePort{{Name: "dn-rpc-port", Port: 7777, TargetPort: intstr.FromInt32(7777)}},
+				Envs:     map[string]string{"dn_rpc_port": "6667"},
+			},
+		},
+	}
+
+	sts := BuildStatefulSet(dataNode)
+	container := sts.Spec.Template.Spec.Containers[0]
+
+	var gotEnv string
+	for _, env := range container.Env {
+		if env.Name == "dn_rpc_port" {
+			gotEnv = env.Value
+		}
+	}
+	if gotEnv != "7777" {
+		t.Fatalf("dn_rpc_port env = %q, want %q (the configured port, not the literal env value)", gotEnv, "7777")
+	}
+
+	var gotContainerPort int32
+	for _, port := range container.Ports {
+		if port.Name == "rpc-port" {
+			gotContainerPort = port.ContainerPort
+		}
+	}
+	if gotContainerPort != 7777 {
+		t.Fatalf("rpc-port container port = %d, want 7777", gotContainerPort)
+	}
+}
+
+func TestBuildStatefulSet_PersistentVolumeClaimRetentionPolicy(t *testing.T) {
+	dataNode := &iotdbv1.DataNode{Spec: iotdbv1.DataNodeSpec{Base: iotdbv1.Base{Replicas: 1}}}
+
+	sts := BuildStatefulSet(dataNode)
+	policy := sts.Spec.PersistentVolumeClaimRetentionPolicy
+	if policy == nil {
+		t.Fatal("expected a PersistentVolumeClaimRetentionPolicy to be set")
+	}
+	if policy.WhenScaled != appsv1.DeletePersistentVolumeClaimRetentionPolicyType || policy.WhenDeleted != appsv1.DeletePersistentVolumeClaimRetentionPolicyType {
+		t.Fatalf("got %+v, want both WhenScaled and WhenDeleted set to Delete", policy)
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mergeutil provides a CreateOrUpdate that three-way-merges a desired object
+// against the live cluster state instead of overwriting Spec wholesale, so fields the
+// API server or an admission webhook injects (ClusterIPs, allocated NodePorts, defaulted
+// StatefulSet values) survive reconciliation.
+package mergeutil
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// LastAppliedAnnotation records the JSON of the object we last asked the API server to
+// apply, used as the "original" side of the three-way merge on the next reconcile.
+const LastAppliedAnnotation = "iotdb.apache.org/last-applied-configuration"
+
+// CreateOrUpdate creates desired, annotated with its own last-applied-configuration, if
+// it does not exist yet. If it does exist, it computes a three-way strategic merge patch
+// between the last-applied annotation, the live object and desired, and applies only the
+// delta the caller actually asked for, leaving server- and webhook-injected fields alone.
+func CreateOrUpdate(ctx context.Context, c client.Client, desired client.Object) (controllerutil.OperationResult, error) {
+	key := client.ObjectKeyFromObject(desired)
+	current := reflect.New(reflect.TypeOf(desired).Elem()).Interface().(client.Object)
+
+	if err := c.Get(ctx, key, current); err != nil {
+		if !errors.IsNotFound(err) {
+			return controllerutil.OperationResultNone, err
+		}
+		if err := setLastApplied(desired); err != nil {
+			return controllerutil.OperationResultNone, err
+		}
+		if err := c.Create(ctx, desired); err != nil {
+			return controllerutil.OperationResultNone, err
+		}
+		return controllerutil.OperationResultCreated, nil
+	}
+
+	// Snapshot desired before it's merged with current, so the annotation we record
+	// reflects only what the caller asked for rather than merged's copy of current's
+	// own (possibly already-annotated) state.
+	desiredRaw, err := json.Marshal(desired)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+
+	merged, changed, err := threeWayMerge(current, desired)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	if !changed {
+		return controllerutil.OperationResultNone, nil
+	}
+
+	if err := setLastAppliedRaw(merged, desiredRaw); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	merged.SetResourceVersion(current.GetResourceVersion())
+	if err := c.Update(ctx, merged); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	return controllerutil.OperationResultUpdated, nil
+}
+
+func setLastApplied(obj client.Object) error {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return setLastAppliedRaw(obj, raw)
+}
+
+// setLastAppliedRaw records raw (a pre-marshaled snapshot of desired, taken before obj
+// was merged with the live object) as obj's last-applied-configuration annotation.
+// Marshaling obj itself here would embed obj's already-merged-in copy of current's
+// last-applied annotation, growing the annotation without bound across reconciles.
+func setLastAppliedRaw(obj client.Object, raw []byte) error {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[LastAppliedAnnotation] = string(raw)
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// threeWayMerge patches current with the strategic merge diff between the last-applied
+// configuration and desired, returning the merged object and whether anything changed.
+func threeWayMerge(current, desired client.Object) (client.Object, bool, error) {
+	lastApplied := []byte(current.GetAnnotations()[LastAppliedAnnotation])
+	if len(lastApplied) == 0 {
+		// No record of what we applied before (object predates this controller, or was
+		// hand-edited); fall back to treating desired as the baseline, so the patch
+		// deletes nothing and we don't clobber fields we never set.
+		var err error
+		lastApplied, err = json.Marshal(desired)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return nil, false, err
+	}
+	desiredJSON, err := json.Marshal(desired)
+	if err != nil {
+		return nil, false, err
+	}
+
+	patchMeta, err := strategicpatch.NewPatchMetaFromStruct(desired)
+	if err != nil {
+		return nil, false, err
+	}
+	patch, err := strategicpatch.CreateThreeWayMergePatch(lastApplied, desiredJSON, currentJSON, patchMeta, true)
+	if err != nil {
+		return nil, false, err
+	}
+	if string(patch) == "{}" {
+		return current, false, nil
+	}
+
+	mergedJSON, err := strategicpatch.StrategicMergePatchUsingLookupPatchMeta(currentJSON, patch, patchMeta)
+	if err != nil {
+		return nil, false, err
+	}
+
+	merged := reflect.New(reflect.TypeOf(current).Elem()).Interface().(client.Object)
+	if err := json.Unmarshal(mergedJSON, merged); err != nil {
+		return nil, false, err
+	}
+	return merged, true, nil
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mergeutil
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func newFakeClient(t *testing.T) client.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).Build()
+}
+
+func testConfigMap(data string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Data:       map[string]string{"key": data},
+	}
+}
+
+func TestCreateOrUpdate_Create(t *testing.T) {
+	c := newFakeClient(t)
+	ctx := context.Background()
+
+	result, err := CreateOrUpdate(ctx, c, testConfigMap("v1"))
+	if err != nil {
+		t.Fatalf("CreateOrUpdate: %v", err)
+	}
+	if result != controllerutil.OperationResultCreated {
+		t.Fatalf("got %v, want OperationResultCreated", result)
+	}
+
+	var got corev1.ConfigMap
+	if err := c.Get(ctx, client.ObjectKey{Name: "test", Namespace: "default"}, &got); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Annotations[LastAppliedAnnotation] == "" {
+		t.Fatal("expected last-applied annotation to be set on create")
+	}
+}
+
+// TestCreateOrUpdate_AnnotationStaysStable reapplies the same desired state twice and
+// asserts the last-applied annotation doesn't grow: a prior bug recorded the
+// already-merged object (which itself embedded the previous last-applied annotation)
+// instead of a clean snapshot of desired, causing the annotation to grow without bound
+// across reconciles.
+func TestCreateOrUpdate_AnnotationStaysStable(t *testing.T) {
+	c := newFakeClient(t)
+	ctx := context.Background()
+
+	if _, err := CreateOrUpdate(ctx, c, testConfigMap("v1")); err != nil {
+		t.Fatalf("initial CreateOrUpdate: %v", err)
+	}
+
+	var first corev1.ConfigMap
+	if err := c.Get(ctx, client.ObjectKey{Name: "test", Namespace: "default"}, &first); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	firstAnnotation := first.Annotations[LastAppliedAnnotation]
+
+	if _, err := CreateOrUpdate(ctx, c, testConfigMap("v1")); err != nil {
+		t.Fatalf("repeat CreateOrUpdate: %v", err)
+	}
+
+	var second corev1.ConfigMap
+	if err := c.Get(ctx, client.ObjectKey{Name: "test", Namespace: "default"}, &second); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	secondAnnotation := second.Annotations[LastAppliedAnnotation]
+
+	if len(secondAnnotation) > len(firstAnnotation) {
+		t.Fatalf("last-applied annotation grew across a no-op reconcile: %d -> %d bytes", len(firstAnnotation), len(secondAnnotation))
+	}
+}
+
+func TestThreeWayMerge_NoopWhenUnchanged(t *testing.T) {
+	current := testConfigMap("v1")
+	current.Annotations = map[string]string{LastAppliedAnnotation: `{"metadata":{"name":"test","namespace":"default","creationTimestamp":null},"data":{"key":"v1"}}`}
+
+	_, changed, err := threeWayMerge(current, testConfigMap("v1"))
+	if err != nil {
+		t.Fatalf("threeWayMerge: %v", err)
+	}
+	if changed {
+		t.Fatal("expected threeWayMerge to report no change when desired matches last-applied and current")
+	}
+}
+
+func TestCreateOrUpdate_UpdateAppliesDelta(t *testing.T) {
+	c := newFakeClient(t)
+	ctx := context.Background()
+
+	if _, err := CreateOrUpdate(ctx, c, testConfigMap("v1")); err != nil {
+		t.Fatalf("initial CreateOrUpdate: %v", err)
+	}
+
+	result, err := CreateOrUpdate(ctx, c, testConfigMap("v2"))
+	if err != nil {
+		t.Fatalf("update CreateOrUpdate: %v", err)
+	}
+	if result != controllerutil.OperationResultUpdated {
+		t.Fatalf("got %v, want OperationResultUpdated", result)
+	}
+
+	var got corev1.ConfigMap
+	if err := c.Get(ctx, client.ObjectKey{Name: "test", Namespace: "default"}, &got); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Data["key"] != "v2" {
+		t.Fatalf("got %q, want %q", got.Data["key"], "v2")
+	}
+}